@@ -0,0 +1,224 @@
+package s3manager
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/client"
+)
+
+// DefaultBatchCopyObjectConcurrency is the default number of objects copied
+// at once by a BatchCopier.
+const DefaultBatchCopyObjectConcurrency = 10
+
+// BatchCopyObject is a single object to be copied as part of a batch.
+type BatchCopyObject struct {
+	Input *CopierInput
+}
+
+// BatchCopyIterator lets a BatchCopier stream sources, for example from
+// ListObjectsV2Pages, without materializing the whole list up front.
+type BatchCopyIterator interface {
+	// Next advances the iterator. It returns false once there are no more
+	// objects or an error has occurred.
+	Next() bool
+
+	// Err returns any error encountered advancing the iterator.
+	Err() error
+
+	// CopyObject returns the object at the iterator's current position.
+	CopyObject() BatchCopyObject
+}
+
+// BatchCopyObjectsIterator is a BatchCopyIterator over an in-memory slice of
+// BatchCopyObjects.
+type BatchCopyObjectsIterator struct {
+	Objects []BatchCopyObject
+
+	index   int
+	started bool
+}
+
+// Next implements BatchCopyIterator.
+func (it *BatchCopyObjectsIterator) Next() bool {
+	if it.started {
+		it.index++
+	}
+	it.started = true
+	return it.index < len(it.Objects)
+}
+
+// Err implements BatchCopyIterator.
+func (it *BatchCopyObjectsIterator) Err() error { return nil }
+
+// CopyObject implements BatchCopyIterator.
+func (it *BatchCopyObjectsIterator) CopyObject() BatchCopyObject {
+	return it.Objects[it.index]
+}
+
+// BatchCopier copies many objects concurrently by driving a single shared
+// Copier from a bounded pool of goroutines. It is analogous to
+// s3manager.BatchDelete and s3manager.BatchUpload, but for server-side
+// copies/moves (bucket-to-bucket, cross-region, or key-prefix mirroring).
+type BatchCopier struct {
+	// Copier performs each individual object copy. It is shared across the
+	// whole batch so its underlying S3 client and connection pool are
+	// reused rather than recreated per object.
+	Copier *Copier
+
+	// ObjectConcurrency is the number of objects copied at once. It is
+	// independent of Copier's own PartSize/Concurrency, which bound the
+	// parts of a single object's multipart copy.
+	ObjectConcurrency int
+
+	// StopOnError halts dispatch of further objects as soon as one Copy
+	// call fails. Objects already in flight are allowed to finish.
+	StopOnError bool
+
+	// Progress, if set, is called after every object finishes (whether it
+	// succeeded or failed) with the running done/total counts and that
+	// object's descriptor. Useful for rendering progress in a CLI or UI.
+	Progress func(done, total int64, last BatchCopyObject)
+}
+
+// NewBatchCopier creates a new BatchCopier using the config provider to
+// build its underlying Copier.
+func NewBatchCopier(cfgp client.ConfigProvider, options ...func(*BatchCopier)) *BatchCopier {
+	b := &BatchCopier{
+		Copier:            NewCopier(cfgp),
+		ObjectConcurrency: DefaultBatchCopyObjectConcurrency,
+	}
+	for _, option := range options {
+		option(b)
+	}
+	return b
+}
+
+// Copy copies every object produced by iter, up to ObjectConcurrency at a
+// time. Objects are dispatched as iter yields them, so a caller streaming
+// from e.g. ListObjectsV2Pages never has to materialize the whole listing.
+// Copy returns nil if every object copied successfully, or a *BatchError
+// aggregating the per-object failures otherwise. If iter reports an error,
+// Copy returns that error instead.
+func (b *BatchCopier) Copy(ctx aws.Context, iter BatchCopyIterator) error {
+	concurrency := b.ObjectConcurrency
+	if concurrency <= 0 {
+		concurrency = DefaultBatchCopyObjectConcurrency
+	}
+
+	// Copies run under the caller's ctx; cancel only stops dispatch, so
+	// StopOnError leaves objects already in flight to finish.
+	copyCtx := ctx
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var total, done int64
+	sem := make(chan struct{}, concurrency)
+	errs := make(chan BatchCopyError)
+
+	var wg sync.WaitGroup
+	go func() {
+		for iter.Next() {
+			if ctx.Err() != nil {
+				break
+			}
+
+			obj := iter.CopyObject()
+			if obj.Input == nil || obj.Input.Dest == nil {
+				errs <- BatchCopyError{OrigErr: awserr.New("ValidationError", "BatchCopyObject has no destination", nil)}
+				continue
+			}
+
+			sem <- struct{}{}
+			if ctx.Err() != nil {
+				<-sem
+				break
+			}
+			atomic.AddInt64(&total, 1)
+			wg.Add(1)
+			go func(obj BatchCopyObject) {
+				defer wg.Done()
+				defer func() { <-sem }()
+
+				err := b.Copier.CopyWithContext(copyCtx, *obj.Input)
+
+				d := atomic.AddInt64(&done, 1)
+				if b.Progress != nil {
+					b.Progress(d, atomic.LoadInt64(&total), obj)
+				}
+
+				if err != nil {
+					errs <- BatchCopyError{
+						OrigErr: err,
+						Bucket:  obj.Input.Dest.Bucket(),
+						Key:     obj.Input.Dest.Key(),
+					}
+					if b.StopOnError {
+						cancel()
+					}
+				}
+			}(obj)
+		}
+		wg.Wait()
+		close(errs)
+	}()
+
+	var batchErrs BatchCopyErrors
+	for e := range errs {
+		batchErrs = append(batchErrs, e)
+	}
+
+	if err := iter.Err(); err != nil {
+		return err
+	}
+	if len(batchErrs) > 0 {
+		return &BatchError{Errors: batchErrs}
+	}
+	return nil
+}
+
+// BatchCopyError records the failure of a single object within a
+// BatchCopier.Copy call. It is the BatchCopier analogue of the
+// BatchDelete/BatchUpload Error type, named separately to avoid redeclaring
+// the same top-level identifier in this package.
+type BatchCopyError struct {
+	OrigErr error
+	Bucket  *string
+	Key     *string
+}
+
+// Error implements the error interface.
+func (e BatchCopyError) Error() string {
+	return fmt.Sprintf("failed to copy to %s/%s: %s",
+		aws.StringValue(e.Bucket), aws.StringValue(e.Key), e.OrigErr)
+}
+
+// BatchCopyErrors is a list of per-object BatchCopier failures.
+type BatchCopyErrors []BatchCopyError
+
+// Error implements the error interface.
+func (errs BatchCopyErrors) Error() string {
+	msg := ""
+	for i, e := range errs {
+		if i > 0 {
+			msg += "\n"
+		}
+		msg += e.Error()
+	}
+	return msg
+}
+
+// BatchError is returned by BatchCopier.Copy when one or more objects failed
+// to copy. Errors holds one entry per failed object.
+type BatchError struct {
+	Errors BatchCopyErrors
+}
+
+// Error implements the error interface.
+func (e *BatchError) Error() string {
+	return fmt.Sprintf("batch copy: %d object(s) failed:\n%s", len(e.Errors), e.Errors.Error())
+}
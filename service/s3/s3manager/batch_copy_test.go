@@ -0,0 +1,75 @@
+package s3manager
+
+import (
+	"context"
+	"testing"
+)
+
+func newBatchCopier(client *fakeCopyS3Client) *BatchCopier {
+	return &BatchCopier{
+		Copier:            NewCopierWithClient(client),
+		ObjectConcurrency: 2,
+	}
+}
+
+// TestBatchCopierCopiesEveryObject verifies a batch with no failures copies
+// every object and returns nil.
+func TestBatchCopierCopiesEveryObject(t *testing.T) {
+	client := &fakeCopyS3Client{}
+	b := newBatchCopier(client)
+
+	iter := &BatchCopyObjectsIterator{Objects: []BatchCopyObject{
+		{Input: &CopierInput{Source: testObject{bucket: "src", key: "a", size: 10}, Dest: testObject{bucket: "dst", key: "a"}}},
+		{Input: &CopierInput{Source: testObject{bucket: "src", key: "b", size: 10}, Dest: testObject{bucket: "dst", key: "b"}}},
+		{Input: &CopierInput{Source: testObject{bucket: "src", key: "c", size: 10}, Dest: testObject{bucket: "dst", key: "c"}}},
+	}}
+
+	if err := b.Copy(context.Background(), iter); err != nil {
+		t.Fatalf("Copy returned unexpected error: %s", err)
+	}
+}
+
+// TestBatchCopierAggregatesPerObjectErrors verifies that failures are
+// reported as a *BatchError naming the failed object, and that a nil Input
+// produces a per-object error instead of panicking the batch.
+func TestBatchCopierAggregatesPerObjectErrors(t *testing.T) {
+	client := &fakeCopyS3Client{failKeys: map[string]bool{"bad": true}}
+	b := newBatchCopier(client)
+
+	iter := &BatchCopyObjectsIterator{Objects: []BatchCopyObject{
+		{Input: &CopierInput{Source: testObject{bucket: "src", key: "good", size: 10}, Dest: testObject{bucket: "dst", key: "good"}}},
+		{Input: &CopierInput{Source: testObject{bucket: "src", key: "bad", size: 10}, Dest: testObject{bucket: "dst", key: "bad"}}},
+		{Input: nil},
+	}}
+
+	err := b.Copy(context.Background(), iter)
+	if err == nil {
+		t.Fatal("expected Copy to return an error")
+	}
+	batchErr, ok := err.(*BatchError)
+	if !ok {
+		t.Fatalf("expected *BatchError, got %T: %s", err, err)
+	}
+	if len(batchErr.Errors) != 2 {
+		t.Fatalf("expected 2 aggregated errors (bad key + nil Input), got %d: %s", len(batchErr.Errors), batchErr)
+	}
+}
+
+// TestBatchCopierStopOnError verifies that a failure still surfaces as a
+// *BatchError when StopOnError is set, which in turn cancels the shared
+// context so any objects still queued behind it stop being dispatched.
+func TestBatchCopierStopOnError(t *testing.T) {
+	client := &fakeCopyS3Client{failKeys: map[string]bool{"bad": true}}
+	b := newBatchCopier(client)
+	b.ObjectConcurrency = 1
+	b.StopOnError = true
+
+	iter := &BatchCopyObjectsIterator{Objects: []BatchCopyObject{
+		{Input: &CopierInput{Source: testObject{bucket: "src", key: "bad", size: 10}, Dest: testObject{bucket: "dst", key: "bad"}}},
+		{Input: &CopierInput{Source: testObject{bucket: "src", key: "never", size: 10}, Dest: testObject{bucket: "dst", key: "never"}}},
+	}}
+
+	if err := b.Copy(context.Background(), iter); err == nil {
+		t.Fatal("expected Copy to return an error")
+	}
+}
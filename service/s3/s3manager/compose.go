@@ -0,0 +1,416 @@
+package s3manager
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// maxComposeObjectSize is the maximum size of the object produced by Compose.
+// It matches S3's overall maximum object size of 5TB.
+const maxComposeObjectSize = 1024 * 1024 * 1024 * 1024 * 5
+
+// ComposeSource describes a single source object to be concatenated by
+// Compose. Sources are copied in the order they appear in ComposerInput.Sources.
+type ComposeSource struct {
+	// Bucket is the source bucket. Bucket is a required field.
+	Bucket *string
+
+	// Key is the source key. Key is a required field.
+	Key *string
+
+	// CopySourceIfMatch pins the copy to a specific version of the source
+	// object by ETag.
+	CopySourceIfMatch *string
+
+	// CopySourceSSECustomerAlgorithm, CopySourceSSECustomerKey, and
+	// CopySourceSSECustomerKeyMD5 are used to decrypt this source if it is
+	// encrypted with SSE-C. KeyMD5 is computed from Key automatically if it
+	// is left unset.
+	CopySourceSSECustomerAlgorithm *string
+	CopySourceSSECustomerKey       *string
+	CopySourceSSECustomerKeyMD5    *string
+
+	// size is discovered via HeadObject during planning.
+	size int64
+}
+
+// ComposerInput holds the input parameters for Copier.Compose.
+type ComposerInput struct {
+	// Sources are concatenated, in order, into Dest.
+	Sources []ComposeSource
+
+	// Dest is the single object produced by the compose.
+	Dest object
+
+	// SSECustomerAlgorithm, SSECustomerKey, and SSECustomerKeyMD5 encrypt
+	// Dest with a customer-provided key. SSECustomerKeyMD5 is computed
+	// from SSECustomerKey automatically if left unset.
+	SSECustomerAlgorithm *string
+	SSECustomerKey       *string
+	SSECustomerKeyMD5    *string
+
+	// SSEKMSKeyId, SSEKMSEncryptionContext, and ServerSideEncryption
+	// encrypt Dest with an AWS KMS-managed key instead of SSE-C.
+	SSEKMSKeyId             *string
+	SSEKMSEncryptionContext *string
+	ServerSideEncryption    *string
+}
+
+// Compose concatenates the ordered Sources in i into a single Dest object
+// using server-side UploadPartCopy requests, the same pattern minio-go calls
+// ComposeObject. Sources are HEAD'd to discover their sizes, then planned
+// into multipart upload parts: sources at least PartSize are split into
+// ranged UploadPartCopy calls, sources smaller than the 5MB per-part minimum
+// are buffered client-side and merged with neighboring parts so every
+// non-final part still satisfies S3's minimum part size.
+//
+// Compose is a Copier method so it shares the worker pool, retry, and
+// abort-on-error behavior of Copy.
+func (c Copier) Compose(i ComposerInput, options ...func(*Copier)) error {
+	return c.ComposeWithContext(context.Background(), i, options...)
+}
+
+// ComposeWithContext performs Compose with the provided context.Context.
+func (c Copier) ComposeWithContext(ctx aws.Context, input ComposerInput, options ...func(*Copier)) error {
+	if len(input.Sources) == 0 {
+		return awserr.New("ValidationError", "Compose requires at least one source", nil)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	impl := copier{
+		in: CopierInput{
+			Dest:                    input.Dest,
+			SSECustomerAlgorithm:    input.SSECustomerAlgorithm,
+			SSECustomerKey:          input.SSECustomerKey,
+			SSECustomerKeyMD5:       input.SSECustomerKeyMD5,
+			SSEKMSKeyId:             input.SSEKMSKeyId,
+			SSEKMSEncryptionContext: input.SSEKMSEncryptionContext,
+			ServerSideEncryption:    input.ServerSideEncryption,
+		},
+		sources: input.Sources,
+		cfg:     c,
+		ctx:     ctx,
+		cancel:  cancel,
+		wg:      &sync.WaitGroup{},
+		m:       &sync.Mutex{},
+	}
+
+	if impl.in.SrcRegion != nil && *impl.in.SrcRegion != "" {
+		srcSess := session.Must(session.NewSession(
+			&aws.Config{Region: impl.in.SrcRegion}))
+		impl.cfg.SrcS3 = s3.New(srcSess)
+	} else {
+		impl.cfg.SrcS3 = impl.cfg.S3
+	}
+
+	for _, option := range options {
+		option(&impl.cfg)
+	}
+
+	impl.cfg.RequestOptions = append(impl.cfg.RequestOptions, request.WithAppendUserAgent("S3Manager"))
+
+	if s, ok := c.S3.(maxRetrier); ok {
+		impl.maxRetries = s.MaxRetries()
+	}
+
+	var err error
+	impl.in.SSECustomerKeyMD5, err = ensureSSECustomerKeyMD5(impl.in.SSECustomerKey, impl.in.SSECustomerKeyMD5)
+	if err != nil {
+		return err
+	}
+	for i := range impl.sources {
+		impl.sources[i].CopySourceSSECustomerKeyMD5, err = ensureSSECustomerKeyMD5(
+			impl.sources[i].CopySourceSSECustomerKey, impl.sources[i].CopySourceSSECustomerKeyMD5)
+		if err != nil {
+			return err
+		}
+	}
+
+	return impl.compose()
+}
+
+// compose is the internal implementation of Compose.
+func (c *copier) compose() error {
+	if err := c.headSources(); err != nil {
+		return err
+	}
+
+	var total int64
+	for _, src := range c.sources {
+		total += src.size
+	}
+	if total > maxComposeObjectSize {
+		msg := fmt.Sprintf("composed object size %d exceeds maximum object size %d", total, maxComposeObjectSize)
+		return awserr.New("ValidationError", msg, nil)
+	}
+
+	plan, err := c.planCompose()
+	if err != nil {
+		return err
+	}
+
+	// A single small source with nothing to merge into falls back to a
+	// plain download + PutObject, there's no multipart upload to make.
+	if len(plan) == 1 && plan[0].Body != nil {
+		return c.putComposedObject(plan[0].Body)
+	}
+
+	uid, err := c.startMulipart(c.in.Dest)
+	if err != nil {
+		return err
+	}
+	logMessage(c.cfg.S3, aws.LogDebug, fmt.Sprintf(
+		"Started MultipartUpload %s\n", *uid))
+
+	c.parts = make([]*s3.CompletedPart, len(plan))
+	c.results = make(chan copyPartResult, c.cfg.Concurrency)
+	c.work = make(chan multipartCopyInput, c.cfg.Concurrency)
+
+	go func() {
+		defer close(c.work)
+		for idx, p := range plan {
+			select {
+			case <-c.ctx.Done():
+				return
+			default:
+			}
+
+			p.Part = int64(idx + 1)
+			p.Bucket = c.in.Dest.Bucket()
+			p.Key = c.in.Dest.Key()
+			p.UploadID = uid
+			c.wg.Add(1)
+			select {
+			case c.work <- p:
+			case <-c.ctx.Done():
+				c.wg.Done()
+				return
+			}
+		}
+	}()
+
+	for i := 0; i < c.cfg.Concurrency; i++ {
+		go c.copyPart()
+	}
+	go c.collect()
+
+	if err := c.wait(); err != nil {
+		c.abort(uid)
+		return err
+	}
+
+	if err := c.getErr(); err != nil {
+		c.abort(uid)
+		return err
+	}
+
+	return c.complete(uid)
+}
+
+// headSources fills in the size of every source that doesn't already have
+// one.
+func (c *copier) headSources() error {
+	for i := range c.sources {
+		src := &c.sources[i]
+		if src.size > 0 {
+			continue
+		}
+		info, err := c.headObject(src.Bucket, src.Key)
+		if err != nil {
+			return err
+		}
+		src.size = aws.Int64Value(info.ContentLength)
+	}
+	return nil
+}
+
+func (c *copier) headObject(bucket, key *string) (*s3.HeadObjectOutput, error) {
+	info, err := c.cfg.SrcS3.HeadObject(&s3.HeadObjectInput{
+		Bucket: bucket,
+		Key:    key,
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok {
+			logMessage(c.cfg.S3, aws.LogDebug, fmt.Sprintf(
+				"Failed to get source object info for %s/%s: %s\n", *bucket, *key, aerr.Error()))
+		} else {
+			logMessage(c.cfg.S3, aws.LogDebug, fmt.Sprintf(
+				"Failed to get source object info for %s/%s: %s\n", *bucket, *key, err))
+		}
+		return nil, err
+	}
+	return info, nil
+}
+
+// composeChunk is a single range of a single source, before the small-chunk
+// merge pass runs.
+type composeChunk struct {
+	source     int
+	start, end int64 // inclusive byte offsets within the source
+}
+
+func (c composeChunk) size() int64 { return c.end - c.start + 1 }
+
+// planCompose slices every source into PartSize chunks, then merges any
+// chunk smaller than MinUploadPartSize forward into its neighbors so every
+// non-final part satisfies S3's minimum part size.
+func (c *copier) planCompose() ([]multipartCopyInput, error) {
+	partSize := c.cfg.PartSize
+	if partSize == 0 {
+		partSize = DefaultCopyPartSize
+	}
+
+	var chunks []composeChunk
+	for i, src := range c.sources {
+		if src.size == 0 {
+			continue
+		}
+		var offset int64
+		for offset < src.size {
+			end := offset + partSize - 1
+			if end >= src.size {
+				end = src.size - 1
+			}
+			chunks = append(chunks, composeChunk{source: i, start: offset, end: end})
+			offset = end + 1
+		}
+	}
+	if len(chunks) == 0 {
+		return nil, awserr.New("ValidationError", "Compose sources are all empty", nil)
+	}
+
+	var plan []multipartCopyInput
+	for i := 0; i < len(chunks); {
+		chunk := chunks[i]
+		last := i == len(chunks)-1
+		// A small final chunk is only safe to hand to UploadPartCopy as-is
+		// when it isn't the only chunk: S3 allows an MPU's last part to be
+		// under the minimum part size, but with nothing to multipart at
+		// all there's no MPU to give it a pass into, so it still needs to
+		// fall into the buffer-and-download branch below.
+		solo := len(chunks) == 1
+		if chunk.size() >= MinUploadPartSize || (last && !solo) {
+			plan = append(plan, c.copyChunkInput(chunk))
+			i++
+			continue
+		}
+
+		// chunk is too small to stand on its own: buffer it and just
+		// enough bytes from the following chunks to clear the minimum
+		// part size, downloading each one in turn. A chunk that's only
+		// partially needed to clear the minimum is split: only the bytes
+		// needed are downloaded, and the remainder is left behind as its
+		// own chunk, so a normal-sized neighbor (often from another
+		// source entirely) doesn't get pulled client-side in full just
+		// because it happened to follow a too-small one.
+		var buf []byte
+		j := i
+		for {
+			next := chunks[j]
+			need := MinUploadPartSize - int64(len(buf))
+			if next.size() > need {
+				prefix := composeChunk{source: next.source, start: next.start, end: next.start + need - 1}
+				remainder := composeChunk{source: next.source, start: next.start + need, end: next.end}
+				data, err := c.downloadChunk(prefix)
+				if err != nil {
+					return nil, err
+				}
+				buf = append(buf, data...)
+				chunks[j] = remainder
+				break
+			}
+
+			data, err := c.downloadChunk(next)
+			if err != nil {
+				return nil, err
+			}
+			buf = append(buf, data...)
+			j++
+			if int64(len(buf)) >= MinUploadPartSize || j == len(chunks) {
+				break
+			}
+		}
+		plan = append(plan, multipartCopyInput{
+			Body:                 buf,
+			SSECustomerAlgorithm: c.in.SSECustomerAlgorithm,
+			SSECustomerKey:       c.in.SSECustomerKey,
+			SSECustomerKeyMD5:    c.in.SSECustomerKeyMD5,
+		})
+		i = j
+	}
+
+	return plan, nil
+}
+
+func (c *copier) copyChunkInput(chunk composeChunk) multipartCopyInput {
+	src := c.sources[chunk.source]
+	return multipartCopyInput{
+		CopySource:                     copySourceString(src.Bucket, src.Key),
+		CopySourceRange:                aws.String(fmt.Sprintf("bytes=%d-%d", chunk.start, chunk.end)),
+		CopySourceIfMatch:              src.CopySourceIfMatch,
+		CopySourceSSECustomerAlgorithm: src.CopySourceSSECustomerAlgorithm,
+		CopySourceSSECustomerKey:       src.CopySourceSSECustomerKey,
+		CopySourceSSECustomerKeyMD5:    src.CopySourceSSECustomerKeyMD5,
+		SSECustomerAlgorithm:           c.in.SSECustomerAlgorithm,
+		SSECustomerKey:                 c.in.SSECustomerKey,
+		SSECustomerKeyMD5:              c.in.SSECustomerKeyMD5,
+	}
+}
+
+func (c *copier) downloadChunk(chunk composeChunk) ([]byte, error) {
+	src := c.sources[chunk.source]
+	out, err := c.cfg.SrcS3.GetObject(&s3.GetObjectInput{
+		Bucket:               src.Bucket,
+		Key:                  src.Key,
+		Range:                aws.String(fmt.Sprintf("bytes=%d-%d", chunk.start, chunk.end)),
+		IfMatch:              src.CopySourceIfMatch,
+		SSECustomerAlgorithm: src.CopySourceSSECustomerAlgorithm,
+		SSECustomerKey:       src.CopySourceSSECustomerKey,
+		SSECustomerKeyMD5:    src.CopySourceSSECustomerKeyMD5,
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer out.Body.Close()
+
+	buf := make([]byte, chunk.size())
+	if _, err := io.ReadFull(out.Body, buf); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+// putComposedObject handles the degenerate case where Compose has nothing to
+// multipart: a single source too small to be its own part.
+func (c *copier) putComposedObject(body []byte) error {
+	_, err := c.cfg.S3.PutObject(&s3.PutObjectInput{
+		Bucket:                  c.in.Dest.Bucket(),
+		Key:                     c.in.Dest.Key(),
+		Body:                    bytes.NewReader(body),
+		SSECustomerAlgorithm:    c.in.SSECustomerAlgorithm,
+		SSECustomerKey:          c.in.SSECustomerKey,
+		SSECustomerKeyMD5:       c.in.SSECustomerKeyMD5,
+		SSEKMSKeyId:             c.in.SSEKMSKeyId,
+		SSEKMSEncryptionContext: c.in.SSEKMSEncryptionContext,
+		ServerSideEncryption:    c.in.ServerSideEncryption,
+	})
+	return err
+}
+
+// copySourceString builds the x-amz-copy-source value for bucket/key, URL
+// encoding the key as required by the UploadPartCopy API.
+func copySourceString(bucket, key *string) *string {
+	escaped := strings.Replace(url.QueryEscape(aws.StringValue(key)), "+", "%20", -1)
+	return aws.String(fmt.Sprintf("%s/%s", aws.StringValue(bucket), escaped))
+}
@@ -0,0 +1,216 @@
+package s3manager
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+)
+
+// fakeComposeS3Client is a stub s3iface.S3API covering the calls Compose
+// makes for a single small source, where planCompose should fall back to a
+// plain download + PutObject instead of a one-part multipart upload.
+type fakeComposeS3Client struct {
+	s3iface.S3API
+
+	mu sync.Mutex
+
+	body []byte
+
+	createMultipartCalls int
+	putObjectCalls       int
+	lastPutObjectInput   *s3.PutObjectInput
+}
+
+func (f *fakeComposeS3Client) HeadObject(in *s3.HeadObjectInput) (*s3.HeadObjectOutput, error) {
+	return &s3.HeadObjectOutput{ContentLength: aws.Int64(int64(len(f.body)))}, nil
+}
+
+func (f *fakeComposeS3Client) GetObject(in *s3.GetObjectInput) (*s3.GetObjectOutput, error) {
+	return &s3.GetObjectOutput{Body: ioutil.NopCloser(bytes.NewReader(f.body))}, nil
+}
+
+func (f *fakeComposeS3Client) PutObject(in *s3.PutObjectInput) (*s3.PutObjectOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.putObjectCalls++
+	f.lastPutObjectInput = in
+	return &s3.PutObjectOutput{}, nil
+}
+
+func (f *fakeComposeS3Client) CreateMultipartUpload(in *s3.CreateMultipartUploadInput) (*s3.CreateMultipartUploadOutput, error) {
+	f.mu.Lock()
+	f.createMultipartCalls++
+	f.mu.Unlock()
+	return &s3.CreateMultipartUploadOutput{UploadId: aws.String("test-upload-id")}, nil
+}
+
+// TestComposeSingleSmallSourceFallsBackToPutObject verifies that a Compose
+// with exactly one source under MinUploadPartSize downloads and re-uploads
+// it directly instead of routing through a one-part multipart upload, which
+// previously couldn't happen: the "last chunk" check in planCompose always
+// took the UploadPartCopy branch first.
+func TestComposeSingleSmallSourceFallsBackToPutObject(t *testing.T) {
+	body := []byte("a small source object")
+	client := &fakeComposeS3Client{body: body}
+	copier := NewCopierWithClient(client)
+
+	err := copier.Compose(ComposerInput{
+		Sources: []ComposeSource{
+			{Bucket: aws.String("src-bucket"), Key: aws.String("src-key")},
+		},
+		Dest: testObject{bucket: "dst-bucket", key: "dst-key"},
+	})
+	if err != nil {
+		t.Fatalf("Compose returned unexpected error: %s", err)
+	}
+
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	if client.createMultipartCalls != 0 {
+		t.Errorf("expected no CreateMultipartUpload calls, got %d", client.createMultipartCalls)
+	}
+	if client.putObjectCalls != 1 {
+		t.Fatalf("expected exactly one PutObject call, got %d", client.putObjectCalls)
+	}
+
+	got, err := ioutil.ReadAll(client.lastPutObjectInput.Body)
+	if err != nil {
+		t.Fatalf("failed to read PutObject body: %s", err)
+	}
+	if !bytes.Equal(got, body) {
+		t.Errorf("PutObject body = %q, want %q", got, body)
+	}
+}
+
+// fakeMultiComposeS3Client is a stub s3iface.S3API covering the calls
+// Compose makes across multiple sources, keyed by "bucket/key", so
+// planCompose's merge-small-chunks-forward logic can be exercised with
+// sources of different sizes.
+type fakeMultiComposeS3Client struct {
+	s3iface.S3API
+
+	mu sync.Mutex
+
+	data map[string][]byte // bucket/key -> full object content
+
+	getObjectBytes       int64 // total bytes ever requested via GetObject
+	uploadPartCopyInputs []*s3.UploadPartCopyInput
+	uploadPartInputs     []*s3.UploadPartInput
+	completed            bool
+}
+
+func (f *fakeMultiComposeS3Client) GetObject(in *s3.GetObjectInput) (*s3.GetObjectOutput, error) {
+	start, end := parseByteRange(aws.StringValue(in.Range))
+	key := aws.StringValue(in.Bucket) + "/" + aws.StringValue(in.Key)
+
+	f.mu.Lock()
+	f.getObjectBytes += end - start + 1
+	f.mu.Unlock()
+
+	return &s3.GetObjectOutput{Body: ioutil.NopCloser(bytes.NewReader(f.data[key][start : end+1]))}, nil
+}
+
+func (f *fakeMultiComposeS3Client) CreateMultipartUpload(in *s3.CreateMultipartUploadInput) (*s3.CreateMultipartUploadOutput, error) {
+	return &s3.CreateMultipartUploadOutput{UploadId: aws.String("test-upload-id")}, nil
+}
+
+func (f *fakeMultiComposeS3Client) UploadPartCopy(in *s3.UploadPartCopyInput) (*s3.UploadPartCopyOutput, error) {
+	f.mu.Lock()
+	f.uploadPartCopyInputs = append(f.uploadPartCopyInputs, in)
+	f.mu.Unlock()
+	return &s3.UploadPartCopyOutput{CopyPartResult: &s3.CopyPartResult{ETag: aws.String("etag")}}, nil
+}
+
+func (f *fakeMultiComposeS3Client) UploadPart(in *s3.UploadPartInput) (*s3.UploadPartOutput, error) {
+	f.mu.Lock()
+	f.uploadPartInputs = append(f.uploadPartInputs, in)
+	f.mu.Unlock()
+	return &s3.UploadPartOutput{ETag: aws.String("etag")}, nil
+}
+
+func (f *fakeMultiComposeS3Client) CompleteMultipartUpload(in *s3.CompleteMultipartUploadInput) (*s3.CompleteMultipartUploadOutput, error) {
+	f.mu.Lock()
+	f.completed = true
+	f.mu.Unlock()
+	return &s3.CompleteMultipartUploadOutput{}, nil
+}
+
+// parseByteRange parses the "bytes=start-end" Range header downloadChunk
+// sends, returning the inclusive start/end offsets.
+func parseByteRange(r string) (start, end int64) {
+	fmt.Sscanf(r, "bytes=%d-%d", &start, &end)
+	return start, end
+}
+
+// TestComposeMergesSmallChunkWithOnlyEnoughOfItsNeighbor verifies two things
+// about planCompose's merge pass: a too-small chunk is still combined with
+// bytes from the next source to clear MinUploadPartSize, but once it has
+// enough, it leaves the rest of that neighbor's chunk to be copied
+// server-side via UploadPartCopy instead of downloading the whole thing.
+func TestComposeMergesSmallChunkWithOnlyEnoughOfItsNeighbor(t *testing.T) {
+	aSize := MinUploadPartSize / 2    // too small to stand alone
+	need := MinUploadPartSize - aSize // bytes required from B to clear the minimum
+	bSize := need + MinUploadPartSize // B: `need` bytes merge into part 1, the rest becomes part 2 on its own
+
+	aData := bytes.Repeat([]byte{'A'}, int(aSize))
+	bData := bytes.Repeat([]byte{'B'}, int(bSize))
+
+	client := &fakeMultiComposeS3Client{
+		data: map[string][]byte{
+			"src-bucket/a": aData,
+			"src-bucket/b": bData,
+		},
+	}
+	copier := NewCopierWithClient(client, func(c *Copier) {
+		c.PartSize = bSize
+	})
+
+	err := copier.Compose(ComposerInput{
+		Sources: []ComposeSource{
+			{Bucket: aws.String("src-bucket"), Key: aws.String("a"), size: aSize},
+			{Bucket: aws.String("src-bucket"), Key: aws.String("b"), size: bSize},
+		},
+		Dest: testObject{bucket: "dst-bucket", key: "dst-key"},
+	})
+	if err != nil {
+		t.Fatalf("Compose returned unexpected error: %s", err)
+	}
+
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	if !client.completed {
+		t.Error("expected CompleteMultipartUpload to be called")
+	}
+
+	wantDownloaded := aSize + need
+	if client.getObjectBytes != wantDownloaded {
+		t.Errorf("downloaded %d bytes client-side, want %d (A in full plus only the prefix of B needed to clear the minimum)",
+			client.getObjectBytes, wantDownloaded)
+	}
+
+	if len(client.uploadPartCopyInputs) != 1 {
+		t.Fatalf("expected exactly one UploadPartCopy call for B's remainder, got %d", len(client.uploadPartCopyInputs))
+	}
+	start, end := parseByteRange(aws.StringValue(client.uploadPartCopyInputs[0].CopySourceRange))
+	if got := end - start + 1; got != MinUploadPartSize {
+		t.Errorf("UploadPartCopy range covers %d bytes, want %d", got, MinUploadPartSize)
+	}
+
+	if len(client.uploadPartInputs) != 1 {
+		t.Fatalf("expected exactly one UploadPart call for the buffered merge, got %d", len(client.uploadPartInputs))
+	}
+	merged, err := ioutil.ReadAll(client.uploadPartInputs[0].Body)
+	if err != nil {
+		t.Fatalf("failed to read merged part body: %s", err)
+	}
+	if int64(len(merged)) != wantDownloaded {
+		t.Errorf("merged part body is %d bytes, want %d", len(merged), wantDownloaded)
+	}
+}
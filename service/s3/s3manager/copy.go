@@ -1,13 +1,13 @@
 package s3manager
 
 import (
+	"bytes"
 	"context"
+	"crypto/md5"
+	"encoding/base64"
 	"fmt"
 	"math"
-	"os"
-	"os/signal"
 	"sync"
-	"syscall"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
@@ -19,10 +19,12 @@ import (
 	"github.com/aws/aws-sdk-go/service/s3/s3iface"
 )
 
-// DefaultCopyPartSize declares the default size of chunks to get copied. It is
-// currently set dumbly to 500MB. So that the maximum object size (5TB) will
-// work without exceeding the maximum part count (10,000).
-const DefaultCopyPartSize = 1024 * 1024 * 500
+// DefaultCopyPartSize declares the default size of chunks to get copied, the
+// same 64MB default docker-distribution uses for its own S3 layer copies.
+// init clamps PartSize upward for objects whose size would otherwise push
+// the part count past maxMultipartCopyParts, so this default doesn't need
+// to be sized for the 5TB/10,000-part worst case itself.
+const DefaultCopyPartSize = 1024 * 1024 * 64
 
 // DefaultCopyConcurrency sets the number of parts to request copying at once.
 const DefaultCopyConcurrency = 64
@@ -32,6 +34,14 @@ const DefaultCopyConcurrency = 64
 // max file size at 1Gbps ~= 12.5 hours. So with leeway...
 const DefaultCopyTimeout = 18 * time.Hour
 
+// DefaultMultipartCopyThreshold is the default object size at or above which
+// Copy switches from a single CopyObject call to a multipart copy.
+const DefaultMultipartCopyThreshold = 1024 * 1024 * 100
+
+// maxMultipartCopyParts is S3's limit on the number of parts in a single
+// multipart upload.
+const maxMultipartCopyParts = 10000
+
 type object interface {
 	Bucket() *string
 	Key() *string
@@ -128,6 +138,28 @@ type CopierInput struct {
 	Delete    bool
 	SrcRegion *string
 	Region    *string
+
+	// CopySourceSSECustomerAlgorithm, CopySourceSSECustomerKey, and
+	// CopySourceSSECustomerKeyMD5 decrypt Source if it is encrypted with a
+	// customer-provided key. CopySourceSSECustomerKeyMD5 is computed from
+	// CopySourceSSECustomerKey automatically if left unset.
+	CopySourceSSECustomerAlgorithm *string
+	CopySourceSSECustomerKey       *string
+	CopySourceSSECustomerKeyMD5    *string
+
+	// SSECustomerAlgorithm, SSECustomerKey, and SSECustomerKeyMD5 encrypt
+	// Dest with a customer-provided key. SSECustomerKeyMD5 is computed
+	// from SSECustomerKey automatically if left unset.
+	SSECustomerAlgorithm *string
+	SSECustomerKey       *string
+	SSECustomerKeyMD5    *string
+
+	// SSEKMSKeyId, SSEKMSEncryptionContext, and ServerSideEncryption
+	// encrypt Dest with an AWS KMS-managed key instead of SSE-C. Unlike
+	// SSE-C these only need to be set once, on CreateMultipartUpload.
+	SSEKMSKeyId             *string
+	SSEKMSEncryptionContext *string
+	ServerSideEncryption    *string
 }
 
 // Copier holds the configuration details for copying from an s3 object to another s3 location.
@@ -135,14 +167,24 @@ type Copier struct {
 	// The chunk size for parts.
 	PartSize int64
 
+	// MultipartCopyThreshold is the object size at or above which Copy switches
+	// from a single CopyObject call to a multipart copy. It is independent
+	// of PartSize, which only controls the chunk size once a multipart
+	// copy has been chosen.
+	MultipartCopyThreshold int64
+
 	// How long to run before we quit waiting.
 	Timeout time.Duration
 
 	// How many parts to copy at once.
 	Concurrency int
 
-	// TODO(ro) 2017-09-07 LeavePartsOnError and abort method.
-	// LeavePartsOnError bool
+	// LeavePartsOnError, when true, skips the AbortMultipartUpload call
+	// that otherwise runs when a multipart copy fails partway through.
+	// Leaving parts around is occasionally useful for debugging, but they
+	// still count against the account's storage until aborted or expired
+	// by a bucket lifecycle rule.
+	LeavePartsOnError bool
 
 	// The s3 client ot use when copying.
 	S3 s3iface.S3API
@@ -178,10 +220,11 @@ func WithCopierRequestOptions(opts ...request.Option) func(*Copier) {
 func NewCopier(cfgp client.ConfigProvider, options ...func(*Copier)) *Copier {
 
 	c := &Copier{
-		PartSize:    DefaultCopyPartSize,
-		Timeout:     DefaultCopyTimeout,
-		S3:          s3.New(cfgp),
-		Concurrency: DefaultCopyConcurrency,
+		PartSize:               DefaultCopyPartSize,
+		MultipartCopyThreshold: DefaultMultipartCopyThreshold,
+		Timeout:                DefaultCopyTimeout,
+		S3:                     s3.New(cfgp),
+		Concurrency:            DefaultCopyConcurrency,
 	}
 	for _, option := range options {
 		option(c)
@@ -209,9 +252,10 @@ func NewCopier(cfgp client.ConfigProvider, options ...func(*Copier)) *Copier {
 // 	})
 func NewCopierWithClient(svc s3iface.S3API, options ...func(*Copier)) *Copier {
 	c := &Copier{
-		S3:          svc,
-		PartSize:    DefaultCopyPartSize,
-		Concurrency: DefaultCopyConcurrency,
+		S3:                     svc,
+		PartSize:               DefaultCopyPartSize,
+		MultipartCopyThreshold: DefaultMultipartCopyThreshold,
+		Concurrency:            DefaultCopyConcurrency,
 	}
 	for _, option := range options {
 		option(c)
@@ -251,11 +295,12 @@ func (c Copier) Copy(i CopierInput, options ...func(*Copier)) error {
 	return c.CopyWithContext(context.Background(), i, options...)
 }
 
-// CopyWithContext performs Copy with the provided context.Context.
+// CopyWithContext performs Copy with the provided context.Context. Canceling
+// ctx (directly, or via signal.NotifyContext for signal-triggered
+// cancellation) aborts the copy and any in-progress multipart upload.
 func (c Copier) CopyWithContext(ctx aws.Context, input CopierInput, options ...func(*Copier)) error {
-	// TODO(ro) 2017-09-07 should cancel be external?
 	ctx, cancel := context.WithCancel(ctx)
-	impl := copier{in: input, cfg: c, ctx: ctx, cancel: cancel, wg: &sync.WaitGroup{}}
+	impl := copier{in: input, cfg: c, ctx: ctx, cancel: cancel, wg: &sync.WaitGroup{}, m: &sync.Mutex{}}
 
 	// Set up a source region. This is to get the source size if it isn't
 	// explicitly provided and for deleting the original source if the option
@@ -279,6 +324,16 @@ func (c Copier) CopyWithContext(ctx aws.Context, input CopierInput, options ...f
 		impl.maxRetries = s.MaxRetries()
 	}
 
+	var err error
+	impl.in.SSECustomerKeyMD5, err = ensureSSECustomerKeyMD5(impl.in.SSECustomerKey, impl.in.SSECustomerKeyMD5)
+	if err != nil {
+		return err
+	}
+	impl.in.CopySourceSSECustomerKeyMD5, err = ensureSSECustomerKeyMD5(impl.in.CopySourceSSECustomerKey, impl.in.CopySourceSSECustomerKeyMD5)
+	if err != nil {
+		return err
+	}
+
 	return impl.copy()
 }
 
@@ -289,6 +344,7 @@ type copier struct {
 	contentLength int64
 
 	in      CopierInput
+	sources []ComposeSource
 	parts   []*s3.CompletedPart
 	results chan copyPartResult
 	work    chan multipartCopyInput
@@ -301,7 +357,7 @@ type copier struct {
 	maxRetries int
 }
 
-func (c copier) getContentLength() error {
+func (c *copier) getContentLength() error {
 	var size int64
 	size = int64(c.in.Source.Size())
 	// If less than 1 we want to double check, because unset == 0. We can make
@@ -318,44 +374,61 @@ func (c copier) getContentLength() error {
 }
 
 // init sets default options if they are 0.
-func (c copier) init() error {
+func (c *copier) init() error {
 	if c.cfg.Concurrency == 0 {
 		c.cfg.Concurrency = DefaultCopyConcurrency
 	}
 	if c.cfg.PartSize == 0 {
 		c.cfg.PartSize = DefaultCopyPartSize
 	}
+	if c.cfg.MultipartCopyThreshold == 0 {
+		c.cfg.MultipartCopyThreshold = DefaultMultipartCopyThreshold
+	}
 
 	if c.cfg.PartSize < MinUploadPartSize {
 		msg := fmt.Sprintf("part size must be at least %d bytes", MinUploadPartSize)
 		return awserr.New("ConfigError", msg, nil)
 	}
+	if c.cfg.PartSize > MaxUploadPartSize {
+		msg := fmt.Sprintf("part size must be at most %d bytes", MaxUploadPartSize)
+		return awserr.New("ConfigError", msg, nil)
+	}
 
 	err := c.getContentLength()
 	if err != nil {
 		msg := fmt.Sprintf("failed to get content length: %s", err.Error())
 		return awserr.New("RequestError", msg, nil)
 	}
+
+	// Clamp PartSize upward so an absurdly small part size against a very
+	// large object doesn't push the part count over S3's 10,000 limit.
+	if (c.contentLength+c.cfg.PartSize-1)/c.cfg.PartSize > maxMultipartCopyParts {
+		c.cfg.PartSize = int64(math.Ceil(float64(c.contentLength) / float64(maxMultipartCopyParts)))
+	}
+
 	return nil
 }
 
 // copy is the internal implementation of Copy.
-func (c copier) copy() error {
-	err := c.init()
+func (c *copier) copy() (err error) {
+	err = c.init()
+	if err != nil {
+		return err
+	}
 
 	// If there's a request to delete the source copy, do it on exit if there
 	// was no error copying.
 	if c.in.Delete {
 		defer func() {
-			if c.err != nil {
+			if err != nil || c.getErr() != nil {
 				return
 			}
 			c.deleteObject(c.in.Source)
 		}()
 	}
 
-	// If smaller than part size, just copy.
-	if c.contentLength < c.cfg.PartSize {
+	// If smaller than the multipart threshold, just copy.
+	if c.contentLength < c.cfg.MultipartCopyThreshold {
 		return c.copyObject()
 
 	}
@@ -375,22 +448,40 @@ func (c copier) copy() error {
 	var partNum int64
 	size := c.contentLength
 	go func() {
+		defer close(c.work)
 		for size >= 0 {
+			select {
+			case <-c.ctx.Done():
+				return
+			default:
+			}
+
 			offset := c.cfg.PartSize * partNum
 			endByte := offset + c.cfg.PartSize - 1
 			if endByte >= c.contentLength {
 				endByte = c.contentLength - 1
 			}
 			mci := multipartCopyInput{
-				Part:            partNum + 1,
-				Bucket:          c.in.Dest.Bucket(),
-				Key:             c.in.Dest.Key(),
-				CopySource:      c.in.Source.CopySourceString(),
-				CopySourceRange: aws.String(fmt.Sprintf("bytes=%d-%d", offset, endByte)),
-				UploadID:        uid,
+				Part:                           partNum + 1,
+				Bucket:                         c.in.Dest.Bucket(),
+				Key:                            c.in.Dest.Key(),
+				CopySource:                     c.in.Source.CopySourceString(),
+				CopySourceRange:                aws.String(fmt.Sprintf("bytes=%d-%d", offset, endByte)),
+				UploadID:                       uid,
+				CopySourceSSECustomerAlgorithm: c.in.CopySourceSSECustomerAlgorithm,
+				CopySourceSSECustomerKey:       c.in.CopySourceSSECustomerKey,
+				CopySourceSSECustomerKeyMD5:    c.in.CopySourceSSECustomerKeyMD5,
+				SSECustomerAlgorithm:           c.in.SSECustomerAlgorithm,
+				SSECustomerKey:                 c.in.SSECustomerKey,
+				SSECustomerKeyMD5:              c.in.SSECustomerKeyMD5,
 			}
 			c.wg.Add(1)
-			c.work <- mci
+			select {
+			case c.work <- mci:
+			case <-c.ctx.Done():
+				c.wg.Done()
+				return
+			}
 			partNum++
 			size -= c.cfg.PartSize
 			if size <= 0 {
@@ -398,23 +489,40 @@ func (c copier) copy() error {
 			}
 
 		}
-		close(c.work)
 	}()
 
 	for i := 0; i < c.cfg.Concurrency; i++ {
 		go c.copyPart()
 	}
 	go c.collect()
-	c.wait()
+
+	if err := c.wait(); err != nil {
+		c.abort(uid)
+		return err
+	}
+
+	if err := c.getErr(); err != nil {
+		c.abort(uid)
+		return err
+	}
 
 	return c.complete(uid)
 }
 
-func (c copier) copyObject() error {
+func (c *copier) copyObject() error {
 	coi := &s3.CopyObjectInput{
-		Bucket:     c.in.Dest.Bucket(),
-		Key:        c.in.Dest.Key(),
-		CopySource: c.in.Source.CopySourceString(),
+		Bucket:                         c.in.Dest.Bucket(),
+		Key:                            c.in.Dest.Key(),
+		CopySource:                     c.in.Source.CopySourceString(),
+		CopySourceSSECustomerAlgorithm: c.in.CopySourceSSECustomerAlgorithm,
+		CopySourceSSECustomerKey:       c.in.CopySourceSSECustomerKey,
+		CopySourceSSECustomerKeyMD5:    c.in.CopySourceSSECustomerKeyMD5,
+		SSECustomerAlgorithm:           c.in.SSECustomerAlgorithm,
+		SSECustomerKey:                 c.in.SSECustomerKey,
+		SSECustomerKeyMD5:              c.in.SSECustomerKeyMD5,
+		SSEKMSKeyId:                    c.in.SSEKMSKeyId,
+		SSEKMSEncryptionContext:        c.in.SSEKMSEncryptionContext,
+		ServerSideEncryption:           c.in.ServerSideEncryption,
 	}
 	_, err := c.cfg.S3.CopyObject(coi)
 	if err != nil {
@@ -433,7 +541,7 @@ func (c copier) copyObject() error {
 
 // collect adds the completed parts to the parts array at the appropriate
 // index.
-func (c copier) collect() {
+func (c *copier) collect() {
 	for r := range c.results {
 		c.parts[r.Part-1] = &s3.CompletedPart{
 			ETag:       r.CopyPartResult.ETag,
@@ -442,84 +550,198 @@ func (c copier) collect() {
 }
 
 // wait prevents the call from completing until work in the goroutines is
-// finished, we timeout, or a signal is caught.
-func (c copier) wait() {
-	sigs := make(chan os.Signal, 1)
-	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM, syscall.SIGKILL)
+// finished or ctx is canceled, either by the caller, by setErr after a worker
+// exhausts its retries, or by the Timeout timer started here (DefaultCopyTimeout
+// when Timeout is unset). On cancellation wait returns at once, without
+// waiting for calls already in flight; the feeder and copyPart workers stop
+// dispatching new UploadPart/UploadPartCopy calls as soon as they next check
+// ctx, rather than draining the whole queued plan. Callers that want
+// signal-triggered cancellation should wire signal.NotifyContext into the
+// context passed to CopyWithContext/ComposeWithContext rather than relying
+// on this package to catch signals.
+func (c *copier) wait() error {
+	timeout := c.cfg.Timeout
+	if timeout == 0 {
+		timeout = DefaultCopyTimeout
+	}
+	timer := time.AfterFunc(timeout, c.cancel)
+	defer timer.Stop()
+
 	done := make(chan struct{})
 	go func() {
-		// fmt.Println("waiting")
 		c.wg.Wait()
 		close(c.results)
-		done <- struct{}{}
+		close(done)
 	}()
 
-	// TODO(ro) 2017-07-20 make an abort method and call
-	// it here when we exit early.
 	select {
 	case <-done:
-		return
-	case sig := <-sigs:
-		c.cancel()
-		logMessage(c.cfg.S3, aws.LogDebug, fmt.Sprintf(
-			"Caught signal %s\n", sig))
-		os.Exit(0)
-	case <-time.After(c.cfg.Timeout):
-		c.cancel()
+		return nil
+	case <-c.ctx.Done():
 		logMessage(c.cfg.S3, aws.LogDebug, fmt.Sprintf(
-			"Copy timed out in %s\n", c.cfg.Timeout))
-		os.Exit(1)
+			"Copy canceled: %s\n", c.ctx.Err()))
+		return c.ctx.Err()
 	}
 }
 
-func (c copier) getErr() error {
+func (c *copier) getErr() error {
 	c.m.Lock()
 	defer c.m.Unlock()
 
 	return c.err
 }
 
-func (c copier) setErr(e error) {
+// setErr records the first error reported by a copyPart worker and cancels
+// ctx so the feeder and any other in-flight workers stop dispatching further
+// parts against an upload that's about to be aborted.
+func (c *copier) setErr(e error) {
 	c.m.Lock()
-	defer c.m.Unlock()
+	if c.err == nil {
+		c.err = e
+	}
+	c.m.Unlock()
 
-	c.err = e
+	c.cancel()
 }
 
-func (c copier) copyPart() {
-	var err error
-	var resp *s3.UploadPartCopyOutput
-	for in := range c.work {
-		upci := &s3.UploadPartCopyInput{
-			Bucket:          in.Bucket,
-			Key:             in.Key,
-			CopySource:      in.CopySource,
-			CopySourceRange: in.CopySourceRange,
-			PartNumber:      aws.Int64(in.Part),
-			UploadId:        in.UploadID,
-		}
-		for retry := 0; retry <= c.maxRetries; retry++ {
-			resp, err = c.cfg.S3.UploadPartCopy(upci)
-			if err != nil {
-				logMessage(c.cfg.S3, aws.LogDebug, fmt.Sprintf(
-					"Error: %s\n Part: %d\n Input %#v\n", err, in.Part, *upci))
+// copyPart dispatches queued parts until c.work is drained or ctx is
+// canceled, e.g. by another worker's setErr. Once canceled it stops issuing
+// new UploadPart/UploadPartCopy calls, but still drains any parts already
+// queued so every c.wg.Add has a matching Done and wait doesn't hang.
+func (c *copier) copyPart() {
+	for {
+		select {
+		case <-c.ctx.Done():
+			for range c.work {
+				c.wg.Done()
+			}
+			return
+		case in, ok := <-c.work:
+			if !ok {
+				return
+			}
+			if c.ctx.Err() != nil {
+				c.wg.Done()
 				continue
 			}
-			c.results <- copyPartResult{
-				Part:           in.Part,
-				CopyPartResult: resp.CopyPartResult}
-			break
+
+			var err error
+			var etag *string
+			if in.Body != nil {
+				etag, err = c.uploadPart(in)
+			} else {
+				etag, err = c.uploadPartCopy(in)
+			}
+			if err != nil {
+				c.setErr(err)
+			} else {
+				select {
+				case c.results <- copyPartResult{
+					Part:           in.Part,
+					CopyPartResult: &s3.CopyPartResult{ETag: etag}}:
+				case <-c.ctx.Done():
+				}
+			}
+			c.wg.Done()
 		}
+	}
+}
+
+// uploadPartCopy performs one retried UploadPartCopy call for a part whose
+// bytes come from another S3 object.
+func (c *copier) uploadPartCopy(in multipartCopyInput) (*string, error) {
+	upci := &s3.UploadPartCopyInput{
+		Bucket:                         in.Bucket,
+		Key:                            in.Key,
+		CopySource:                     in.CopySource,
+		CopySourceRange:                in.CopySourceRange,
+		CopySourceIfMatch:              in.CopySourceIfMatch,
+		CopySourceSSECustomerAlgorithm: in.CopySourceSSECustomerAlgorithm,
+		CopySourceSSECustomerKey:       in.CopySourceSSECustomerKey,
+		CopySourceSSECustomerKeyMD5:    in.CopySourceSSECustomerKeyMD5,
+		// The destination's SSE-C headers, if any, must be repeated on
+		// every part request, not just CreateMultipartUpload.
+		SSECustomerAlgorithm: in.SSECustomerAlgorithm,
+		SSECustomerKey:       in.SSECustomerKey,
+		SSECustomerKeyMD5:    in.SSECustomerKeyMD5,
+		PartNumber:           aws.Int64(in.Part),
+		UploadId:             in.UploadID,
+	}
+
+	var err error
+	var resp *s3.UploadPartCopyOutput
+	for retry := 0; retry <= c.maxRetries; retry++ {
+		resp, err = c.cfg.S3.UploadPartCopy(upci)
+		if err != nil {
+			logMessage(c.cfg.S3, aws.LogDebug, fmt.Sprintf(
+				"Error: %s\n Part: %d\n Input %#v\n", err, in.Part, redactSSEKeys(*upci)))
+			continue
+		}
+		return resp.CopyPartResult.ETag, nil
+	}
+	return nil, err
+}
+
+// uploadPart performs one retried UploadPart call for a part whose bytes
+// were buffered client-side, e.g. by Compose merging small sources together.
+func (c *copier) uploadPart(in multipartCopyInput) (*string, error) {
+	upi := &s3.UploadPartInput{
+		Bucket:               in.Bucket,
+		Key:                  in.Key,
+		PartNumber:           aws.Int64(in.Part),
+		UploadId:             in.UploadID,
+		Body:                 bytes.NewReader(in.Body),
+		SSECustomerAlgorithm: in.SSECustomerAlgorithm,
+		SSECustomerKey:       in.SSECustomerKey,
+		SSECustomerKeyMD5:    in.SSECustomerKeyMD5,
+	}
+
+	var err error
+	var resp *s3.UploadPartOutput
+	for retry := 0; retry <= c.maxRetries; retry++ {
+		upi.Body = bytes.NewReader(in.Body)
+		resp, err = c.cfg.S3.UploadPart(upi)
 		if err != nil {
-			c.setErr(err)
+			logMessage(c.cfg.S3, aws.LogDebug, fmt.Sprintf(
+				"Error: %s\n Part: %d\n", err, in.Part))
+			continue
 		}
-		c.wg.Done()
+		return resp.ETag, nil
+	}
+	return nil, err
+}
+
+// redactSSEKeys returns a copy of in with its SSE-C keys blanked so they
+// never land in debug logs.
+func redactSSEKeys(in s3.UploadPartCopyInput) s3.UploadPartCopyInput {
+	if in.CopySourceSSECustomerKey != nil {
+		in.CopySourceSSECustomerKey = aws.String("<redacted>")
+	}
+	if in.SSECustomerKey != nil {
+		in.SSECustomerKey = aws.String("<redacted>")
+	}
+	return in
+}
+
+// abort cancels a dangling multipart upload after a worker has exhausted its
+// retries, unless the caller opted into LeavePartsOnError.
+func (c *copier) abort(uid *string) {
+	if c.cfg.LeavePartsOnError {
+		return
+	}
+	amui := &s3.AbortMultipartUploadInput{
+		Bucket:   c.in.Dest.Bucket(),
+		Key:      c.in.Dest.Key(),
+		UploadId: uid,
+	}
+	if _, err := c.cfg.S3.AbortMultipartUpload(amui); err != nil {
+		logMessage(c.cfg.S3, aws.LogDebug, fmt.Sprintf(
+			"Failed to abort MultipartUpload %s: %s\n", *uid, err))
 	}
-	return
 }
 
 // complete finishes this multipart copy.
-func (c copier) complete(uid *string) error {
+func (c *copier) complete(uid *string) error {
 	cmui := &s3.CompleteMultipartUploadInput{
 		Bucket:   c.in.Dest.Bucket(),
 		Key:      c.in.Dest.Key(),
@@ -545,17 +767,47 @@ type copyPartResult struct {
 type multipartCopyInput struct {
 	Part int64
 
-	Bucket          *string
-	CopySource      *string
-	CopySourceRange *string
-	Key             *string
-	UploadID        *string
+	Bucket   *string
+	Key      *string
+	UploadID *string
+
+	// CopySource and its range/precondition headers describe a
+	// server-side UploadPartCopy part.
+	CopySource        *string
+	CopySourceRange   *string
+	CopySourceIfMatch *string
+
+	// CopySourceSSECustomerAlgorithm, CopySourceSSECustomerKey, and
+	// CopySourceSSECustomerKeyMD5 decrypt the source named by CopySource,
+	// when it is set.
+	CopySourceSSECustomerAlgorithm *string
+	CopySourceSSECustomerKey       *string
+	CopySourceSSECustomerKeyMD5    *string
+
+	// SSECustomerAlgorithm, SSECustomerKey, and SSECustomerKeyMD5 encrypt
+	// the destination object with a customer-provided key. S3 requires
+	// these on every part request of an SSE-C multipart upload, not just
+	// CreateMultipartUpload.
+	SSECustomerAlgorithm *string
+	SSECustomerKey       *string
+	SSECustomerKeyMD5    *string
+
+	// Body carries client-buffered bytes for parts that Compose couldn't
+	// satisfy with a single UploadPartCopy call. When Body is set, the
+	// part is uploaded with UploadPart instead of UploadPartCopy.
+	Body []byte
 }
 
-func (c copier) startMulipart(o object) (*string, error) {
+func (c *copier) startMulipart(o object) (*string, error) {
 	cmui := &s3.CreateMultipartUploadInput{
-		Bucket: c.in.Dest.Bucket(),
-		Key:    c.in.Dest.Key(),
+		Bucket:                  c.in.Dest.Bucket(),
+		Key:                     c.in.Dest.Key(),
+		SSECustomerAlgorithm:    c.in.SSECustomerAlgorithm,
+		SSECustomerKey:          c.in.SSECustomerKey,
+		SSECustomerKeyMD5:       c.in.SSECustomerKeyMD5,
+		SSEKMSKeyId:             c.in.SSEKMSKeyId,
+		SSEKMSEncryptionContext: c.in.SSEKMSEncryptionContext,
+		ServerSideEncryption:    c.in.ServerSideEncryption,
 	}
 	resp, err := c.cfg.S3.CreateMultipartUpload(cmui)
 	if err != nil {
@@ -564,7 +816,23 @@ func (c copier) startMulipart(o object) (*string, error) {
 	return resp.UploadId, nil
 }
 
-func (c copier) objectInfo(o object) (*s3.HeadObjectOutput, error) {
+// ensureSSECustomerKeyMD5 returns keyMD5 unchanged if it is already set, or
+// if key is unset.
+// Otherwise it derives the MD5 S3 expects from the raw bytes of key, the
+// same way minio-go computes it for its caller-supplied keys.
+func ensureSSECustomerKeyMD5(key, keyMD5 *string) (*string, error) {
+	if key == nil || keyMD5 != nil {
+		return keyMD5, nil
+	}
+	raw, err := base64.StdEncoding.DecodeString(*key)
+	if err != nil {
+		return nil, awserr.New("ValidationError", "SSECustomerKey must be base64 encoded", err)
+	}
+	sum := md5.Sum(raw)
+	return aws.String(base64.StdEncoding.EncodeToString(sum[:])), nil
+}
+
+func (c *copier) objectInfo(o object) (*s3.HeadObjectOutput, error) {
 	info, err := c.cfg.SrcS3.HeadObject(&s3.HeadObjectInput{
 		Bucket: c.in.Source.Bucket(),
 		Key:    c.in.Source.Key(),
@@ -0,0 +1,287 @@
+package s3manager
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+)
+
+// testObject is a minimal object implementation for exercising Copier
+// against a fake S3 client, without pulling in whatever concrete type the
+// rest of this package normally uses to describe a bucket/key pair.
+type testObject struct {
+	bucket, key string
+	size        int
+}
+
+func (o testObject) Bucket() *string { return aws.String(o.bucket) }
+func (o testObject) Key() *string    { return aws.String(o.key) }
+func (o testObject) CopySourceString() *string {
+	return copySourceString(aws.String(o.bucket), aws.String(o.key))
+}
+func (o testObject) String() string { return o.bucket + "/" + o.key }
+func (o testObject) Size() int      { return o.size }
+
+// fakeCopyS3Client is a stub s3iface.S3API that only implements the calls
+// Copier makes, failing loudly (via the embedded nil interface) on anything
+// else.
+type fakeCopyS3Client struct {
+	s3iface.S3API
+
+	mu sync.Mutex
+
+	uploadPartCopyCalls int
+	failPart            int64 // UploadPartCopy fails for this part number; 0 disables
+
+	aborted   bool
+	completed bool
+
+	lastCopyObjectInput     *s3.CopyObjectInput
+	lastUploadPartCopyInput *s3.UploadPartCopyInput
+
+	// failKeys, if set, names destination keys that CopyObject should fail
+	// for, used to exercise BatchCopier's per-object error handling.
+	failKeys map[string]bool
+}
+
+func (f *fakeCopyS3Client) CreateMultipartUpload(in *s3.CreateMultipartUploadInput) (*s3.CreateMultipartUploadOutput, error) {
+	return &s3.CreateMultipartUploadOutput{UploadId: aws.String("test-upload-id")}, nil
+}
+
+func (f *fakeCopyS3Client) UploadPartCopy(in *s3.UploadPartCopyInput) (*s3.UploadPartCopyOutput, error) {
+	f.mu.Lock()
+	f.uploadPartCopyCalls++
+	f.lastUploadPartCopyInput = in
+	f.mu.Unlock()
+
+	if f.failPart != 0 && aws.Int64Value(in.PartNumber) == f.failPart {
+		return nil, awserr.New("InternalError", "simulated UploadPartCopy failure", nil)
+	}
+	return &s3.UploadPartCopyOutput{
+		CopyPartResult: &s3.CopyPartResult{ETag: aws.String("etag")},
+	}, nil
+}
+
+func (f *fakeCopyS3Client) CopyObject(in *s3.CopyObjectInput) (*s3.CopyObjectOutput, error) {
+	f.mu.Lock()
+	f.lastCopyObjectInput = in
+	fail := f.failKeys[aws.StringValue(in.Key)]
+	f.mu.Unlock()
+
+	if fail {
+		return nil, awserr.New("InternalError", "simulated CopyObject failure", nil)
+	}
+	return &s3.CopyObjectOutput{}, nil
+}
+
+func (f *fakeCopyS3Client) CompleteMultipartUpload(in *s3.CompleteMultipartUploadInput) (*s3.CompleteMultipartUploadOutput, error) {
+	f.mu.Lock()
+	f.completed = true
+	f.mu.Unlock()
+	return &s3.CompleteMultipartUploadOutput{}, nil
+}
+
+func (f *fakeCopyS3Client) AbortMultipartUpload(in *s3.AbortMultipartUploadInput) (*s3.AbortMultipartUploadOutput, error) {
+	f.mu.Lock()
+	f.aborted = true
+	f.mu.Unlock()
+	return &s3.AbortMultipartUploadOutput{}, nil
+}
+
+// TestCopyAbortsOnPartFailure verifies that a permanently failing part
+// actually surfaces as an error from Copy and triggers AbortMultipartUpload,
+// rather than being swallowed by a copier whose error state never reaches
+// the caller.
+func TestCopyAbortsOnPartFailure(t *testing.T) {
+	client := &fakeCopyS3Client{failPart: 2}
+
+	copier := NewCopierWithClient(client, func(c *Copier) {
+		c.PartSize = MinUploadPartSize
+		c.MultipartCopyThreshold = MinUploadPartSize
+		c.Concurrency = 2
+	})
+
+	src := testObject{bucket: "src-bucket", key: "src-key", size: int(3 * MinUploadPartSize)}
+	dst := testObject{bucket: "dst-bucket", key: "dst-key"}
+
+	err := copier.Copy(CopierInput{Source: src, Dest: dst})
+	if err == nil {
+		t.Fatal("expected Copy to return an error when a part permanently fails")
+	}
+
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	if !client.aborted {
+		t.Error("expected AbortMultipartUpload to be called after a part failed")
+	}
+	if client.completed {
+		t.Error("expected CompleteMultipartUpload not to be called after a part failed")
+	}
+}
+
+// TestCopyRejectsPartSizeAboveMax verifies init() rejects a PartSize above
+// S3's 5GB per-part maximum rather than passing it straight through to
+// CreateMultipartUpload.
+func TestCopyRejectsPartSizeAboveMax(t *testing.T) {
+	client := &fakeCopyS3Client{}
+	copier := NewCopierWithClient(client, func(c *Copier) {
+		c.PartSize = MaxUploadPartSize + 1
+	})
+
+	src := testObject{bucket: "src-bucket", key: "src-key", size: 10}
+	dst := testObject{bucket: "dst-bucket", key: "dst-key"}
+
+	if err := copier.Copy(CopierInput{Source: src, Dest: dst}); err == nil {
+		t.Fatal("expected Copy to reject a PartSize above MaxUploadPartSize")
+	}
+}
+
+// TestCopyObjectForwardsSSE verifies that a copy under MultipartCopyThreshold
+// (the common case) still carries SSE-C/SSE-KMS headers through to
+// CopyObject, instead of silently dropping them on the single-object path.
+func TestCopyObjectForwardsSSE(t *testing.T) {
+	client := &fakeCopyS3Client{}
+	copier := NewCopierWithClient(client)
+
+	src := testObject{bucket: "src-bucket", key: "src-key", size: 10}
+	dst := testObject{bucket: "dst-bucket", key: "dst-key"}
+
+	err := copier.Copy(CopierInput{
+		Source:                         src,
+		Dest:                           dst,
+		CopySourceSSECustomerAlgorithm: aws.String("AES256"),
+		CopySourceSSECustomerKey:       aws.String("c291cmNla2V5MTIzNDU2Nzg5MDEyMw=="),
+		SSECustomerAlgorithm:           aws.String("AES256"),
+		SSECustomerKey:                 aws.String("ZGVzdGtleTEyMzQ1Njc4OTAxMjM="),
+		SSEKMSKeyId:                    aws.String("arn:aws:kms:us-east-1:1234567890:key/test"),
+		ServerSideEncryption:           aws.String("aws:kms"),
+	})
+	if err != nil {
+		t.Fatalf("Copy returned unexpected error: %s", err)
+	}
+
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	in := client.lastCopyObjectInput
+	if in == nil {
+		t.Fatal("expected CopyObject to be called")
+	}
+	if aws.StringValue(in.CopySourceSSECustomerAlgorithm) != "AES256" {
+		t.Error("expected CopySourceSSECustomerAlgorithm to be forwarded")
+	}
+	if in.CopySourceSSECustomerKeyMD5 == nil {
+		t.Error("expected CopySourceSSECustomerKeyMD5 to be computed and forwarded")
+	}
+	if aws.StringValue(in.SSECustomerAlgorithm) != "AES256" {
+		t.Error("expected SSECustomerAlgorithm to be forwarded")
+	}
+	if in.SSECustomerKeyMD5 == nil {
+		t.Error("expected SSECustomerKeyMD5 to be computed and forwarded")
+	}
+	if aws.StringValue(in.SSEKMSKeyId) == "" {
+		t.Error("expected SSEKMSKeyId to be forwarded")
+	}
+	if aws.StringValue(in.ServerSideEncryption) != "aws:kms" {
+		t.Error("expected ServerSideEncryption to be forwarded")
+	}
+}
+
+// TestUploadPartCopyForwardsSSE verifies that a copy at or above
+// MultipartCopyThreshold still carries SSE-C headers through to each
+// UploadPartCopyInput, instead of silently dropping them on the multipart
+// path.
+func TestUploadPartCopyForwardsSSE(t *testing.T) {
+	client := &fakeCopyS3Client{}
+	copier := NewCopierWithClient(client, func(c *Copier) {
+		c.PartSize = MinUploadPartSize
+		c.MultipartCopyThreshold = MinUploadPartSize
+	})
+
+	src := testObject{bucket: "src-bucket", key: "src-key", size: int(2 * MinUploadPartSize)}
+	dst := testObject{bucket: "dst-bucket", key: "dst-key"}
+
+	err := copier.Copy(CopierInput{
+		Source:                         src,
+		Dest:                           dst,
+		CopySourceSSECustomerAlgorithm: aws.String("AES256"),
+		CopySourceSSECustomerKey:       aws.String("c291cmNla2V5MTIzNDU2Nzg5MDEyMw=="),
+		SSECustomerAlgorithm:           aws.String("AES256"),
+		SSECustomerKey:                 aws.String("ZGVzdGtleTEyMzQ1Njc4OTAxMjM="),
+	})
+	if err != nil {
+		t.Fatalf("Copy returned unexpected error: %s", err)
+	}
+
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	if client.uploadPartCopyCalls == 0 {
+		t.Fatal("expected at least one UploadPartCopy call")
+	}
+	in := client.lastUploadPartCopyInput
+	if in == nil {
+		t.Fatal("expected UploadPartCopy to be called")
+	}
+	if aws.StringValue(in.CopySourceSSECustomerAlgorithm) != "AES256" {
+		t.Error("expected CopySourceSSECustomerAlgorithm to be forwarded")
+	}
+	if in.CopySourceSSECustomerKeyMD5 == nil {
+		t.Error("expected CopySourceSSECustomerKeyMD5 to be computed and forwarded")
+	}
+	if aws.StringValue(in.SSECustomerAlgorithm) != "AES256" {
+		t.Error("expected SSECustomerAlgorithm to be forwarded")
+	}
+	if in.SSECustomerKeyMD5 == nil {
+		t.Error("expected SSECustomerKeyMD5 to be computed and forwarded")
+	}
+}
+
+// TestCopyWithContextCanceledReturnsPromptly verifies that CopyWithContext
+// given an already-canceled context returns ctx.Err() promptly, aborts the
+// multipart upload it started, and never dispatches any part requests,
+// rather than hanging in wait's wg.Wait() or racing a double wg.Done().
+func TestCopyWithContextCanceledReturnsPromptly(t *testing.T) {
+	client := &fakeCopyS3Client{}
+	copier := NewCopierWithClient(client, func(c *Copier) {
+		c.PartSize = MinUploadPartSize
+		c.MultipartCopyThreshold = MinUploadPartSize
+		c.Concurrency = 4
+	})
+
+	src := testObject{bucket: "src-bucket", key: "src-key", size: int(3 * MinUploadPartSize)}
+	dst := testObject{bucket: "dst-bucket", key: "dst-key"}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- copier.CopyWithContext(ctx, CopierInput{Source: src, Dest: dst})
+	}()
+
+	select {
+	case err := <-errCh:
+		if err == nil {
+			t.Fatal("expected CopyWithContext to return an error for a canceled context")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("CopyWithContext did not return promptly after context cancellation")
+	}
+
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	if !client.aborted {
+		t.Error("expected AbortMultipartUpload to be called after cancellation")
+	}
+	if client.completed {
+		t.Error("expected CompleteMultipartUpload not to be called after cancellation")
+	}
+	if client.uploadPartCopyCalls != 0 {
+		t.Errorf("expected no UploadPartCopy calls after cancellation, got %d", client.uploadPartCopyCalls)
+	}
+}